@@ -0,0 +1,1137 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	tlsint "github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/influxdata/telegraf/plugins/outputs"
+)
+
+// Framing describes how syslog messages are delimited on a stream transport.
+type Framing int
+
+const (
+	// OctetCounting prefixes every message with its length, e.g. "58 <PRI>...".
+	OctetCounting Framing = iota
+	// NonTransparent terminates every message with a Trailer byte (RFC 6587).
+	NonTransparent
+)
+
+// UnmarshalText sets the Framing from its TOML string representation
+// ("octet-counting" or "non-transparent"), as used by sampleConfig's
+// framing setting.
+func (f *Framing) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "octet-counting":
+		*f = OctetCounting
+	case "non-transparent":
+		*f = NonTransparent
+	default:
+		return fmt.Errorf("invalid framing %q", text)
+	}
+	return nil
+}
+
+// MarshalText renders the Framing back to its TOML string representation.
+func (f Framing) MarshalText() ([]byte, error) {
+	switch f {
+	case OctetCounting:
+		return []byte("octet-counting"), nil
+	case NonTransparent:
+		return []byte("non-transparent"), nil
+	default:
+		return nil, fmt.Errorf("invalid framing %v", f)
+	}
+}
+
+// Trailer is the byte appended after a message when using NonTransparent framing.
+type Trailer int
+
+const (
+	// NUL is the null byte trailer.
+	NUL Trailer = iota
+	// LF is the line feed trailer.
+	LF
+)
+
+// Value returns the byte sequence a Trailer represents.
+func (t Trailer) Value() (string, error) {
+	switch t {
+	case NUL:
+		return "\x00", nil
+	case LF:
+		return "\n", nil
+	default:
+		return "", fmt.Errorf("invalid trailer %v", t)
+	}
+}
+
+// UnmarshalText sets the Trailer from its TOML string representation
+// ("NUL" or "LF"), as used by sampleConfig's trailer setting.
+func (t *Trailer) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "NUL":
+		*t = NUL
+	case "LF":
+		*t = LF
+	default:
+		return fmt.Errorf("invalid trailer %q", text)
+	}
+	return nil
+}
+
+// MarshalText renders the Trailer back to its TOML string representation.
+func (t Trailer) MarshalText() ([]byte, error) {
+	switch t {
+	case NUL:
+		return []byte("NUL"), nil
+	case LF:
+		return []byte("LF"), nil
+	default:
+		return nil, fmt.Errorf("invalid trailer %v", t)
+	}
+}
+
+const defaultSeparator = "_"
+
+const (
+	// RFC5424Format emits syslog messages per RFC 5424 (the default).
+	RFC5424Format = "RFC5424"
+	// RFC3164Format emits legacy BSD syslog messages per RFC 3164.
+	RFC3164Format = "RFC3164"
+)
+
+var sampleConfig = `
+  ## Syslog server address, e.g.: tcp://127.0.0.1:514, udp://127.0.0.1:514,
+  ## tls://127.0.0.1:6514, unix:///run/systemd/journal/syslog,
+  ## unixgram:///dev/log. Use tls:// (or tcp+tls://) for a TLS/mutual-TLS
+  ## connection.
+  address = "tcp://127.0.0.1:514"
+
+  ## Optional TLS configuration.
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification.
+  # insecure_skip_verify = false
+
+  ## Syslog message format to emit. Must be one of "RFC5424" (the default,
+  ## https://tools.ietf.org/html/rfc5424) or "RFC3164" (the legacy BSD
+  ## syslog format, https://tools.ietf.org/html/rfc3164), for collectors
+  ## and network devices that don't understand RFC5424 yet.
+  # format = "RFC5424"
+
+  ## Framing technique used for messages transported over streaming protocols.
+  ## Set to "octet-counting" as per RFC5425#section-4.3.1 or "non-transparent"
+  ## as per RFC6587#section-3.4.2. Must be one of "octet-counting",
+  ## "non-transparent".
+  # framing = "octet-counting"
+
+  ## Trailer to be appended in case of non-transparent framing. Must be
+  ## one of "LF" or "NUL".
+  # trailer = "NUL"
+
+  ## SD-PARAMs settings
+  ## Syslog messages can contain various structured data (SD). To carry
+  ## specific telegraf field names and values as structured data parameters
+  ## the plugin will use fields with names starting with "sdid", e.g.
+  ## "<sdid>_<key>": "value".
+  ## A Specific SDID can be defined as default. This will be used when no
+  ## specific SDID prefixed field is matched.
+  # default_sdid = ""
+  ## List of non-default SDIDs recognized.
+  # sdids = ["foo@123", "bar@456"]
+
+  ## Default Severity value. Severity and Facility are used to calculate the
+  ## PRI value (https://tools.ietf.org/html/rfc5424#section-6.2.1).
+  # default_severity_code = 0
+  ## Default Facility value.
+  # default_facility_code = 0
+  ## Default APP-NAME value.
+  # default_appname = "Telegraf"
+
+  ## Maximum number of messages to hold in memory while the connection to
+  ## the syslog server is down. Write() only fails once this is exceeded
+  ## and spool_dir isn't set.
+  # queue_size = 1000
+  ## Optional directory used to spill messages to disk once queue_size is
+  ## exceeded, so a prolonged outage doesn't drop metrics.
+  # spool_dir = ""
+
+  ## Minimum and maximum delay between reconnection attempts. The delay
+  ## doubles on every failed attempt, up to reconnect_max, with jitter
+  ## applied to avoid reconnect storms.
+  # reconnect_min = "500ms"
+  # reconnect_max = "30s"
+`
+
+const (
+	defaultQueueSize    = 1000
+	defaultReconnectMin = 500 * time.Millisecond
+	defaultReconnectMax = 30 * time.Second
+)
+
+// Syslog is an output plugin that sends metrics as RFC 5424 (or, when Format
+// is RFC3164, RFC 3164) syslog messages.
+type Syslog struct {
+	Address             string          `toml:"address"`
+	Format              string          `toml:"format"`
+	DefaultSeverityCode uint8           `toml:"default_severity_code"`
+	DefaultFacilityCode uint8           `toml:"default_facility_code"`
+	DefaultAppname      string          `toml:"default_appname"`
+	Sdids               []string        `toml:"sdids"`
+	DefaultSdid         string          `toml:"default_sdid"`
+	Separator           string          `toml:"sdparam_separator"`
+	Framing             Framing         `toml:"framing"`
+	Trailer             Trailer         `toml:"trailer"`
+	QueueSize           int             `toml:"queue_size"`
+	SpoolDir            string          `toml:"spool_dir"`
+	ReconnectMin        config.Duration `toml:"reconnect_min"`
+	ReconnectMax        config.Duration `toml:"reconnect_max"`
+
+	tlsint.ClientConfig
+
+	tlsConfig    *tls.Config
+	isStream     bool
+	Conn         net.Conn
+	connVerified bool
+
+	queue     *sendQueue
+	queueOnce sync.Once
+	stopCh    chan struct{}
+	startOnce sync.Once
+	wg        sync.WaitGroup
+
+	hostnameOnce   sync.Once
+	cachedHostname string
+
+	mu sync.Mutex
+}
+
+// Description returns a one-sentence description of the plugin.
+func (s *Syslog) Description() string {
+	return "Configuration for Syslog server to send metrics to"
+}
+
+// SampleConfig returns the default configuration of the plugin.
+func (s *Syslog) SampleConfig() string {
+	return sampleConfig
+}
+
+// Connect establishes the outbound connection used to ship syslog messages
+// and starts the background sender that drains the send queue.
+func (s *Syslog) Connect() error {
+	if err := s.ensureQueue(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	err := s.dial()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.startSender()
+	return nil
+}
+
+// dial opens the configured transport. Callers must hold s.mu.
+func (s *Syslog) dial() error {
+	spl := strings.SplitN(s.Address, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid address: %s", s.Address)
+	}
+	scheme := spl[0]
+
+	tlsCfg, err := s.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	s.tlsConfig = tlsCfg
+
+	switch scheme {
+	case "tcp", "tcp4", "tcp6":
+		s.isStream = true
+		conn, err := net.Dial(scheme, spl[1])
+		if err != nil {
+			return err
+		}
+		s.Conn = conn
+	case "udp", "udp4", "udp6":
+		s.isStream = false
+		conn, err := net.Dial(scheme, spl[1])
+		if err != nil {
+			return err
+		}
+		s.Conn = conn
+	case "unix":
+		s.isStream = true
+		conn, err := net.Dial("unix", spl[1])
+		if err != nil {
+			return err
+		}
+		s.Conn = conn
+	case "unixgram":
+		s.isStream = false
+		// unixgram is datagram-based like udp, so octet-counting framing
+		// (meant for streams) doesn't apply: octet-counting, whether
+		// configured or left as the default, is replaced with non-transparent.
+		if s.Framing == OctetCounting {
+			s.Framing = NonTransparent
+		}
+		conn, err := net.Dial("unixgram", spl[1])
+		if err != nil {
+			return err
+		}
+		s.Conn = conn
+	case "tls", "tcp+tls":
+		s.isStream = true
+		if s.tlsConfig == nil {
+			s.tlsConfig = &tls.Config{}
+		}
+		conn, err := tls.Dial("tcp", spl[1], s.tlsConfig)
+		if err != nil {
+			return err
+		}
+		s.Conn = conn
+	default:
+		return fmt.Errorf("unsupported scheme: %s", scheme)
+	}
+
+	// A freshly dialed connection hasn't been checked for staleness yet:
+	// sendLoop probes it before trusting its first write.
+	s.connVerified = false
+	return nil
+}
+
+// reconnect re-dials the configured transport, used by the background
+// sender to recover from a lost connection.
+func (s *Syslog) reconnect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dial()
+}
+
+// ensureQueue lazily creates the send queue using the configured QueueSize
+// and SpoolDir. It is idempotent so it can be called from both Connect and
+// Write.
+func (s *Syslog) ensureQueue() error {
+	var err error
+	s.queueOnce.Do(func() {
+		s.queue, err = newSendQueue(s.QueueSize, s.SpoolDir)
+	})
+	return err
+}
+
+// startSender launches the background goroutine that drains the send queue,
+// reconnecting with exponential backoff when the connection is down. It
+// only ever runs once per plugin instance.
+func (s *Syslog) startSender() {
+	s.startOnce.Do(func() {
+		s.stopCh = make(chan struct{})
+		s.wg.Add(1)
+		go s.sendLoop()
+	})
+}
+
+// sendLoop drains the send queue in order, writing each message to the
+// connection and reconnecting with exponential backoff whenever it's down.
+func (s *Syslog) sendLoop() {
+	defer s.wg.Done()
+
+	backoff := s.reconnectMin()
+	for {
+		b, ok := s.queue.pop(s.stopCh)
+		if !ok {
+			return
+		}
+
+		for {
+			s.mu.Lock()
+			conn := s.Conn
+			s.mu.Unlock()
+
+			if conn == nil {
+				if err := s.reconnect(); err != nil {
+					if !s.sleep(withJitter(backoff)) {
+						return
+					}
+					backoff = nextBackoff(backoff, s.reconnectMax())
+					continue
+				}
+				backoff = s.reconnectMin()
+				s.mu.Lock()
+				conn = s.Conn
+				s.mu.Unlock()
+			}
+
+			// A connection that was established before this round of
+			// sending (e.g. reused across an outage that closed the peer
+			// without this plugin ever writing to it) may already be
+			// dead: a write into a closed-peer socket can still return a
+			// nil error, since the RST often doesn't surface until a
+			// later read or write. Probe once per connection, before
+			// trusting its first write, so such a message is retried on
+			// a fresh connection instead of silently dropped.
+			if !s.connAlreadyVerified() {
+				if !probeConnAlive(conn) {
+					s.closeConn(conn)
+					continue
+				}
+				s.markConnVerified(conn)
+			}
+
+			if _, err := conn.Write(b); err != nil {
+				s.closeConn(conn)
+				continue
+			}
+			break
+		}
+	}
+}
+
+// connAlreadyVerified reports whether the current connection has already
+// passed a liveness probe.
+func (s *Syslog) connAlreadyVerified() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connVerified
+}
+
+// markConnVerified records that conn survived a liveness probe, provided
+// it's still the active connection.
+func (s *Syslog) markConnVerified(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Conn == conn {
+		s.connVerified = true
+	}
+}
+
+// closeConn tears down conn and clears it from the plugin, provided it's
+// still the active connection, so the next sendLoop iteration reconnects.
+func (s *Syslog) closeConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Conn == conn {
+		conn.Close()
+		s.Conn = nil
+	}
+}
+
+// connProbeTimeout bounds how long sendLoop waits to observe a pending
+// RST or EOF from a peer that closed the connection earlier.
+const connProbeTimeout = 20 * time.Millisecond
+
+// probeConnAlive checks whether conn is still usable by attempting a read
+// bounded by connProbeTimeout: a timeout means nothing arrived but the
+// connection is otherwise healthy, while EOF or a reset indicates the peer
+// is gone.
+func probeConnAlive(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(connProbeTimeout)); err != nil {
+		return true
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var one [1]byte
+	if _, err := conn.Read(one[:]); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// sleep waits for d, returning false early if the sender has been stopped.
+func (s *Syslog) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-s.stopCh:
+		return false
+	}
+}
+
+func (s *Syslog) reconnectMin() time.Duration {
+	if time.Duration(s.ReconnectMin) <= 0 {
+		return defaultReconnectMin
+	}
+	return time.Duration(s.ReconnectMin)
+}
+
+func (s *Syslog) reconnectMax() time.Duration {
+	if time.Duration(s.ReconnectMax) <= 0 {
+		return defaultReconnectMax
+	}
+	return time.Duration(s.ReconnectMax)
+}
+
+// nextBackoff doubles cur, capped at max.
+func nextBackoff(cur, max time.Duration) time.Duration {
+	next := cur * 2
+	if next <= 0 || next > max {
+		next = max
+	}
+	return next
+}
+
+// withJitter randomizes d to within [d/2, d], to avoid reconnect storms
+// against a collector that just came back up.
+func withJitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2))
+}
+
+// Write enqueues the given metrics for delivery, returning an error only
+// when the send queue is full. It never blocks on the socket: delivery
+// happens on the background sender started by Connect.
+func (s *Syslog) Write(metrics []telegraf.Metric) error {
+	if err := s.ensureQueue(); err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		msg, err := s.mapMetricToSyslogMessage(m)
+		if err != nil {
+			return err
+		}
+		b := s.getSyslogMessageBytesWithFraming(msg)
+
+		if err := s.queue.push(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close stops the background sender and closes the underlying connection.
+func (s *Syslog) Close() error {
+	if s.stopCh != nil {
+		close(s.stopCh)
+	}
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Conn == nil {
+		return nil
+	}
+	err := s.Conn.Close()
+	s.Conn = nil
+	return err
+}
+
+// syslogMessage is satisfied by every message format the plugin can emit.
+type syslogMessage interface {
+	String() (string, bool)
+}
+
+// sendQueue is the in-memory ring buffer of already-framed messages waiting
+// to be shipped to the syslog server. Once it fills up, messages overflow
+// to a diskSpool when one is configured, otherwise push reports the queue
+// as full.
+type sendQueue struct {
+	ch    chan []byte
+	spool *diskSpool
+}
+
+// newSendQueue creates a send queue holding up to size messages in memory,
+// spilling to spoolDir on overflow when spoolDir is non-empty.
+func newSendQueue(size int, spoolDir string) (*sendQueue, error) {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	spool, err := newDiskSpool(spoolDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sendQueue{ch: make(chan []byte, size), spool: spool}, nil
+}
+
+// push enqueues a message, spilling to disk or reporting the queue as full
+// once its in-memory capacity is exhausted.
+func (q *sendQueue) push(b []byte) error {
+	// Once messages have spilled to disk, keep spilling until the spool is
+	// drained so order is preserved: otherwise a later message could land
+	// in ch and overtake earlier messages still waiting on disk.
+	if q.spool == nil || !q.spool.hasPending() {
+		select {
+		case q.ch <- b:
+			return nil
+		default:
+		}
+	}
+
+	if q.spool == nil {
+		return fmt.Errorf("syslog send queue is full (queue_size=%d)", cap(q.ch))
+	}
+	return q.spool.write(b)
+}
+
+// pop blocks until a message is available or stop is closed, returning
+// false in the latter case. In-memory messages are returned before the disk
+// spool is read: push only lets messages into memory while the spool is
+// empty, so whatever is in memory is older than anything on disk.
+func (q *sendQueue) pop(stop <-chan struct{}) ([]byte, bool) {
+	select {
+	case b := <-q.ch:
+		return b, true
+	default:
+	}
+
+	if q.spool != nil {
+		if b, ok := q.spool.read(); ok {
+			return b, true
+		}
+	}
+
+	select {
+	case b, ok := <-q.ch:
+		return b, ok
+	case <-stop:
+		return nil, false
+	}
+}
+
+// diskSpool is an append-only, length-prefixed overflow log used to bound
+// sendQueue's memory usage during a prolonged outage. The read offset is
+// persisted in a sidecar file alongside the spool so that a restart resumes
+// where the previous run left off, rather than redelivering every message
+// ever spilled and leaving the spool file to grow without bound.
+type diskSpool struct {
+	mu         sync.Mutex
+	offsetPath string
+	wf         *os.File
+	rf         *os.File
+	pending    int64
+}
+
+// newDiskSpool opens (creating if necessary) the spool file under dir,
+// resuming from the read offset a previous run left behind, if any. A nil
+// diskSpool and nil error are returned when dir is empty, meaning spilling
+// is disabled.
+func newDiskSpool(dir string) (*diskSpool, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "syslog.spool")
+	offsetPath := path + ".offset"
+
+	wf, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	rf, err := os.Open(path)
+	if err != nil {
+		wf.Close()
+		return nil, err
+	}
+
+	offset, err := readSpoolOffset(offsetPath)
+	if err != nil {
+		wf.Close()
+		rf.Close()
+		return nil, err
+	}
+	if _, err := rf.Seek(offset, io.SeekStart); err != nil {
+		wf.Close()
+		rf.Close()
+		return nil, err
+	}
+
+	pending, err := countSpoolEntries(rf)
+	if err != nil {
+		wf.Close()
+		rf.Close()
+		return nil, err
+	}
+	if _, err := rf.Seek(offset, io.SeekStart); err != nil {
+		wf.Close()
+		rf.Close()
+		return nil, err
+	}
+
+	d := &diskSpool{offsetPath: offsetPath, wf: wf, rf: rf, pending: pending}
+	if pending == 0 {
+		if err := d.compactLocked(); err != nil {
+			wf.Close()
+			rf.Close()
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// readSpoolOffset returns the byte offset up to which spool records have
+// already been delivered, or 0 if path doesn't exist yet (a fresh spool, or
+// one from a telegraf version that predates offset tracking).
+func readSpoolOffset(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(b) != 8 {
+		return 0, nil
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+// writeSpoolOffset persists the byte offset up to which spool records have
+// been delivered, via a temp file and rename so a crash mid-write can't
+// leave behind a corrupt, partially-written offset.
+func writeSpoolOffset(path string, offset int64) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(offset))
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b[:], 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// countSpoolEntries scans the length-prefixed records from rf's current
+// position to EOF, so messages that were spilled but never delivered are
+// picked back up instead of being silently orphaned. The caller is
+// responsible for seeking rf back afterwards.
+func countSpoolEntries(rf *os.File) (int64, error) {
+	var hdr [4]byte
+	var count int64
+	for {
+		if _, err := io.ReadFull(rf, hdr[:]); err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return 0, err
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[:]))
+		if _, err := rf.Seek(n, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
+
+func (d *diskSpool) hasPending() bool {
+	return atomic.LoadInt64(&d.pending) > 0
+}
+
+// write appends a length-prefixed message to the spool file.
+func (d *diskSpool) write(b []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(b)))
+	if _, err := d.wf.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := d.wf.Write(b); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&d.pending, 1)
+	return nil
+}
+
+// read recovers the oldest un-delivered message from the spool file, if
+// any. The new read offset is persisted so a restart resumes after this
+// message instead of redelivering it, and once every spilled message has
+// been delivered the spool is compacted back to empty.
+func (d *diskSpool) read() ([]byte, bool) {
+	if !d.hasPending() {
+		return nil, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var hdr [4]byte
+	if _, err := io.ReadFull(d.rf, hdr[:]); err != nil {
+		return nil, false
+	}
+	b := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	if _, err := io.ReadFull(d.rf, b); err != nil {
+		return nil, false
+	}
+
+	if atomic.AddInt64(&d.pending, -1) == 0 {
+		// A failed compaction just leaves the drained spool file in place
+		// to be rescanned (and skipped, since it's now all delivered) by
+		// the next restart: the message already read is still returned.
+		d.compactLocked()
+	} else if offset, err := d.rf.Seek(0, io.SeekCurrent); err == nil {
+		// Best-effort: a crash before this persists only risks redelivering
+		// b on restart, not losing it.
+		writeSpoolOffset(d.offsetPath, offset)
+	}
+
+	return b, true
+}
+
+// compactLocked truncates the spool file back to empty and clears the
+// persisted read offset, now that every spilled message has been
+// delivered. Callers must hold d.mu.
+func (d *diskSpool) compactLocked() error {
+	if err := d.wf.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := d.rf.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeSpoolOffset(d.offsetPath, 0)
+}
+
+// getSyslogMessageBytesWithFraming applies the configured framing technique
+// to a syslog message.
+func (s *Syslog) getSyslogMessageBytesWithFraming(msg syslogMessage) []byte {
+	str, _ := msg.String()
+
+	switch s.Framing {
+	case NonTransparent:
+		trailer, _ := s.Trailer.Value()
+		return []byte(str + trailer)
+	default: // OctetCounting
+		return []byte(strconv.Itoa(len(str)) + " " + str)
+	}
+}
+
+// rfc5424Message represents an RFC 5424 syslog message.
+type rfc5424Message struct {
+	priority  uint8
+	version   int
+	timestamp time.Time
+	hostname  string
+	appname   string
+	procID    string
+	msgID     string
+	sdParams  map[string]map[string]string
+	message   string
+	hasMsg    bool
+}
+
+// String renders the message using the RFC 5424 wire format.
+func (m *rfc5424Message) String() (string, bool) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>%d %s %s %s %s %s %s",
+		m.priority,
+		m.version,
+		m.timestamp.UTC().Format(time.RFC3339),
+		nvl(m.hostname),
+		nvl(m.appname),
+		nvl(m.procID),
+		nvl(m.msgID),
+		m.structuredData(),
+	)
+	if m.hasMsg {
+		b.WriteString(" ")
+		b.WriteString(m.message)
+	}
+	return b.String(), true
+}
+
+func (m *rfc5424Message) structuredData() string {
+	if len(m.sdParams) == 0 {
+		return "-"
+	}
+
+	sdids := make([]string, 0, len(m.sdParams))
+	for sdid := range m.sdParams {
+		sdids = append(sdids, sdid)
+	}
+	sort.Strings(sdids)
+
+	var b strings.Builder
+	for _, sdid := range sdids {
+		params := m.sdParams[sdid]
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		b.WriteString("[")
+		b.WriteString(sdid)
+		for _, name := range names {
+			fmt.Fprintf(&b, " %s=%q", name, params[name])
+		}
+		b.WriteString("]")
+	}
+	return b.String()
+}
+
+func nvl(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// hostname returns the local hostname, resolved once and cached for the
+// lifetime of the plugin instance.
+func (s *Syslog) hostname() string {
+	s.hostnameOnce.Do(func() {
+		if hostname, err := os.Hostname(); err == nil {
+			s.cachedHostname = hostname
+		}
+	})
+	return s.cachedHostname
+}
+
+// mapMetricToSyslogMessage converts a telegraf.Metric into a syslog message
+// in the configured Format (RFC5424 by default, or RFC3164).
+func (s *Syslog) mapMetricToSyslogMessage(m telegraf.Metric) (syslogMessage, error) {
+	if s.Format == RFC3164Format {
+		return s.mapMetricToSyslogMessageRFC3164(m)
+	}
+	return s.mapMetricToSyslogMessageRFC5424(m)
+}
+
+// mapMetricToSyslogMessageRFC5424 converts a telegraf.Metric into an RFC 5424
+// syslog message, pulling well-known syslog fields (PRI, MSG, HOSTNAME,
+// APP-NAME, PROCID, MSGID) out of the metric's fields and routing any
+// remaining fields into structured data under the configured SDIDs.
+func (s *Syslog) mapMetricToSyslogMessageRFC5424(m telegraf.Metric) (*rfc5424Message, error) {
+	msg := &rfc5424Message{
+		version:   1,
+		timestamp: m.Time(),
+		appname:   s.DefaultAppname,
+		msgID:     m.Name(),
+		sdParams:  make(map[string]map[string]string),
+	}
+	if msg.appname == "" {
+		msg.appname = "Telegraf"
+	}
+
+	msg.hostname = s.hostname()
+
+	priority := uint8(s.DefaultFacilityCode)*8 + uint8(s.DefaultSeverityCode)
+	msg.priority = priority
+
+	knownSdids := make(map[string]bool, len(s.Sdids)+1)
+	for _, sdid := range s.Sdids {
+		knownSdids[sdid] = true
+	}
+	if s.DefaultSdid != "" {
+		knownSdids[s.DefaultSdid] = true
+	}
+
+	separator := s.Separator
+	if separator == "" {
+		separator = defaultSeparator
+	}
+
+	fields := m.Fields()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := fields[name]
+		switch name {
+		case "PRI":
+			msg.priority = toUint8(value)
+		case "MSG":
+			msg.message = fmt.Sprintf("%v", value)
+			msg.hasMsg = true
+		case "HOSTNAME", "SOURCE":
+			msg.hostname = fmt.Sprintf("%v", value)
+		case "APP-NAME":
+			msg.appname = fmt.Sprintf("%v", value)
+		case "PROCID":
+			msg.procID = fmt.Sprintf("%v", value)
+		case "MSGID":
+			msg.msgID = fmt.Sprintf("%v", value)
+		default:
+			sdid, param, ok := s.splitSdidParam(name, separator, knownSdids)
+			if !ok {
+				continue
+			}
+			if msg.sdParams[sdid] == nil {
+				msg.sdParams[sdid] = make(map[string]string)
+			}
+			msg.sdParams[sdid][param] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return msg, nil
+}
+
+// splitSdidParam determines which SDID (if any) a generic field name belongs
+// to. A field prefixed with "<sdid><separator>" is routed to that SDID with
+// the prefix stripped; an unprefixed field is routed to the default SDID, if
+// one is configured. Fields that match neither are dropped.
+func (s *Syslog) splitSdidParam(name, separator string, knownSdids map[string]bool) (sdid, param string, ok bool) {
+	if idx := strings.Index(name, separator); idx > 0 {
+		prefix := name[:idx]
+		if knownSdids[prefix] {
+			return prefix, name[idx+len(separator):], true
+		}
+	}
+	if s.DefaultSdid != "" {
+		return s.DefaultSdid, name, true
+	}
+	return "", "", false
+}
+
+// rfc3164Message represents a legacy BSD syslog message (RFC 3164).
+type rfc3164Message struct {
+	priority  uint8
+	timestamp time.Time
+	hostname  string
+	tag       string
+	procID    string
+	message   string
+}
+
+// String renders the message using the RFC 3164 wire format:
+// "<PRI>Mmm dd hh:mm:ss HOST TAG[PID]: MSG".
+func (m *rfc3164Message) String() (string, bool) {
+	tag := m.tag
+	if m.procID != "" {
+		tag = fmt.Sprintf("%s[%s]", tag, m.procID)
+	}
+	return fmt.Sprintf("<%d>%s %s %s: %s",
+		m.priority,
+		m.timestamp.Local().Format(time.Stamp),
+		nvl(m.hostname),
+		tag,
+		m.message,
+	), true
+}
+
+// rfc3164HeaderFields are the metric field names kept out of the generated
+// message body: all but MSGID are used as RFC 3164 header values or as the
+// message itself, while MSGID, which RFC 3164 has no place for, is dropped.
+var rfc3164HeaderFields = map[string]bool{
+	"PRI": true, "MSG": true, "HOSTNAME": true, "SOURCE": true,
+	"APP-NAME": true, "PROCID": true, "MSGID": true,
+}
+
+// mapMetricToSyslogMessageRFC3164 converts a telegraf.Metric into an RFC 3164
+// (BSD) syslog message. As with the RFC 5424 mapper, PRI/HOSTNAME(SOURCE)/
+// APP-NAME/PROCID/MSG fields are pulled out as header values; when no MSG
+// field is present, the message body is built from the metric name and its
+// remaining fields.
+func (s *Syslog) mapMetricToSyslogMessageRFC3164(m telegraf.Metric) (*rfc3164Message, error) {
+	msg := &rfc3164Message{
+		timestamp: m.Time(),
+		tag:       s.DefaultAppname,
+	}
+	if msg.tag == "" {
+		msg.tag = "Telegraf"
+	}
+	msg.hostname = s.hostname()
+	msg.priority = uint8(s.DefaultFacilityCode)*8 + uint8(s.DefaultSeverityCode)
+
+	fields := m.Fields()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var hasMsg bool
+	for _, name := range names {
+		value := fields[name]
+		switch name {
+		case "PRI":
+			msg.priority = toUint8(value)
+		case "MSG":
+			msg.message = fmt.Sprintf("%v", value)
+			hasMsg = true
+		case "HOSTNAME", "SOURCE":
+			msg.hostname = fmt.Sprintf("%v", value)
+		case "APP-NAME":
+			msg.tag = fmt.Sprintf("%v", value)
+		case "PROCID":
+			msg.procID = fmt.Sprintf("%v", value)
+		}
+	}
+
+	if !hasMsg {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			if rfc3164HeaderFields[name] {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%s=%v", name, fields[name]))
+		}
+		if len(parts) == 0 {
+			msg.message = m.Name()
+		} else {
+			msg.message = fmt.Sprintf("%s %s", m.Name(), strings.Join(parts, ","))
+		}
+	}
+
+	return msg, nil
+}
+
+func toUint8(v interface{}) uint8 {
+	switch n := v.(type) {
+	case uint64:
+		return uint8(n)
+	case int64:
+		return uint8(n)
+	case int:
+		return uint8(n)
+	default:
+		i, _ := strconv.Atoi(fmt.Sprintf("%v", v))
+		return uint8(i)
+	}
+}
+
+// newSyslog creates a Syslog output with its default configuration applied.
+func newSyslog() *Syslog {
+	return &Syslog{
+		Format:              RFC5424Format,
+		Framing:             OctetCounting,
+		Trailer:             NUL,
+		Separator:           defaultSeparator,
+		DefaultAppname:      "Telegraf",
+		DefaultSeverityCode: 0,
+		DefaultFacilityCode: 0,
+		QueueSize:           defaultQueueSize,
+		ReconnectMin:        config.Duration(defaultReconnectMin),
+		ReconnectMax:        config.Duration(defaultReconnectMax),
+	}
+}
+
+func init() {
+	outputs.Add("syslog", func() telegraf.Output { return newSyslog() })
+}
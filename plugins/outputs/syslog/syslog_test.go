@@ -1,13 +1,24 @@
 package syslog
 
 import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"os"
-	"sync"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +44,54 @@ func TestSyslogMapperWithDefaults(t *testing.T) {
 	assert.Equal(t, "<0>1 2010-11-10T23:00:00Z "+hostname+" Telegraf - testmetric -", str, "Wrong syslog message")
 }
 
+func TestSyslogMapperRFC3164WithDefaults(t *testing.T) {
+	// Init plugin
+	s := newSyslog()
+	s.Format = RFC3164Format
+
+	// Init metrics
+	ts := time.Date(2010, time.November, 10, 23, 0, 0, 0, time.UTC)
+	m1, _ := metric.New(
+		"testmetric",
+		map[string]string{},
+		map[string]interface{}{},
+		ts,
+	)
+	hostname, err := os.Hostname()
+	assert.NoError(t, err)
+	syslogMessage, err := s.mapMetricToSyslogMessage(m1)
+	require.NoError(t, err)
+	str, _ := syslogMessage.String()
+	expected := "<0>" + ts.Local().Format(time.Stamp) + " " + hostname + " Telegraf: testmetric"
+	assert.Equal(t, expected, str, "Wrong RFC3164 syslog message")
+}
+
+func TestSyslogMapperRFC3164WithFields(t *testing.T) {
+	// Init plugin
+	s := newSyslog()
+	s.Format = RFC3164Format
+
+	// Init metrics
+	ts := time.Date(2010, time.November, 10, 23, 0, 0, 0, time.UTC)
+	m1, _ := metric.New(
+		"testmetric",
+		map[string]string{},
+		map[string]interface{}{
+			"PRI":      uint64(0),
+			"MSG":      "Test message",
+			"HOSTNAME": "testhost",
+			"APP-NAME": "testapp",
+			"PROCID":   uint64(25),
+		},
+		ts,
+	)
+	syslogMessage, err := s.mapMetricToSyslogMessage(m1)
+	require.NoError(t, err)
+	str, _ := syslogMessage.String()
+	expected := "<0>" + ts.Local().Format(time.Stamp) + " testhost testapp[25]: Test message"
+	assert.Equal(t, expected, str, "Wrong RFC3164 syslog message")
+}
+
 func TestSyslogMapperWithDefaultSdid(t *testing.T) {
 	// Init plugin
 	s := newSyslog()
@@ -196,6 +255,119 @@ func TestSyslogWriteWithUdp(t *testing.T) {
 	testSyslogWriteWithPacket(t, s, listener)
 }
 
+func TestSyslogWriteWithUnix(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "syslog.sock")
+
+	listener, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	s := newSyslog()
+	s.Address = "unix://" + sockPath
+
+	err = s.Connect()
+	require.NoError(t, err)
+
+	lconn, err := listener.Accept()
+	require.NoError(t, err)
+
+	testSyslogWriteWithStream(t, s, lconn)
+}
+
+func TestSyslogWriteWithUnixgram(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "syslog.sock")
+
+	listener, err := net.ListenPacket("unixgram", sockPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	s := newSyslog()
+	s.Address = "unixgram://" + sockPath
+
+	err = s.Connect()
+	require.NoError(t, err)
+
+	testSyslogWriteWithPacket(t, s, listener)
+}
+
+func TestSyslogWriteWithTls(t *testing.T) {
+	cert := generateSelfSignedCert(t)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	})
+	require.NoError(t, err)
+
+	s := newSyslog()
+	s.Address = "tls://" + listener.Addr().String()
+	s.InsecureSkipVerify = true
+
+	// tls.Listener.Accept only wraps the raw connection: the server-side
+	// handshake itself is lazy and doesn't run until the wrapped conn is
+	// first read from or written to. Accept and handshake must both
+	// happen concurrently with Connect(), otherwise the client's
+	// tls.Dial blocks forever waiting for a handshake the server never
+	// starts.
+	acceptResult := make(chan net.Conn, 1)
+	acceptErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			acceptErr <- err
+			return
+		}
+		if err := conn.(*tls.Conn).Handshake(); err != nil {
+			acceptErr <- err
+			return
+		}
+		acceptResult <- conn
+	}()
+
+	err = s.Connect()
+	require.NoError(t, err)
+
+	var lconn net.Conn
+	select {
+	case lconn = <-acceptResult:
+	case err := <-acceptErr:
+		require.NoError(t, err)
+	}
+
+	testSyslogWriteWithStream(t, s, lconn)
+}
+
+// generateSelfSignedCert creates an in-memory self-signed certificate for
+// 127.0.0.1, used to stand up a TLS listener for tests.
+func generateSelfSignedCert(t *testing.T) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := tls.X509KeyPair(
+		pemBlock("CERTIFICATE", der),
+		pemBlock("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+	)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func pemBlock(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
 func testSyslogWriteWithStream(t *testing.T, s *Syslog, lconn net.Conn) {
 	metrics := []telegraf.Metric{}
 	m1, _ := metric.New(
@@ -241,68 +413,101 @@ func testSyslogWriteWithPacket(t *testing.T, s *Syslog, lconn net.PacketConn) {
 	assert.Equal(t, string(messageBytesWithFraming), string(buf[:n]))
 }
 
-func TestSyslogWriteErr(t *testing.T) {
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
-	require.NoError(t, err)
-
+// TestSyslogWriteQueueFull and TestSyslogWriteReconnectInOrder replace the
+// old TestSyslogWriteErr/TestSyslogWriteReconnect: Write is now async and
+// queues rather than failing synchronously on a dead connection, so the
+// guarantee worth asserting is that Write still errors once the queue is
+// truly full (this test) and that a dropped connection is recovered
+// without losing or reordering messages (TestSyslogWriteReconnectInOrder).
+func TestSyslogWriteQueueFull(t *testing.T) {
 	s := newSyslog()
-	s.Address = "tcp://" + listener.Addr().String()
-
-	err = s.Connect()
-	require.NoError(t, err)
-	s.Conn.(*net.TCPConn).SetReadBuffer(256)
-
-	lconn, err := listener.Accept()
-	require.NoError(t, err)
-	lconn.(*net.TCPConn).SetWriteBuffer(256)
+	s.QueueSize = 2
 
-	metrics := []telegraf.Metric{testutil.TestMetric(1, "testerr")}
+	// Never call Connect, so nothing drains the queue: pushes beyond
+	// QueueSize must report the queue as full rather than block.
+	m := testutil.TestMetric(1, "testerr")
+	for i := 0; i < s.QueueSize; i++ {
+		require.NoError(t, s.Write([]telegraf.Metric{m}))
+	}
 
-	// close the socket to generate an error
-	lconn.Close()
-	s.Conn.Close()
-	err = s.Write(metrics)
+	err := s.Write([]telegraf.Metric{m})
 	require.Error(t, err)
-	assert.Nil(t, s.Conn)
 }
 
-func TestSyslogWriteReconnect(t *testing.T) {
+func TestSyslogWriteReconnectInOrder(t *testing.T) {
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
+	addr := listener.Addr().String()
 
 	s := newSyslog()
-	s.Address = "tcp://" + listener.Addr().String()
+	s.Address = "tcp://" + addr
+	s.ReconnectMin = config.Duration(10 * time.Millisecond)
+	s.ReconnectMax = config.Duration(50 * time.Millisecond)
 
-	err = s.Connect()
-	require.NoError(t, err)
-	s.Conn.(*net.TCPConn).SetReadBuffer(256)
+	require.NoError(t, s.Connect())
+	defer s.Close()
 
 	lconn, err := listener.Accept()
 	require.NoError(t, err)
-	lconn.(*net.TCPConn).SetWriteBuffer(256)
-	lconn.Close()
-	s.Conn = nil
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	var lerr error
-	go func() {
-		lconn, lerr = listener.Accept()
-		wg.Done()
-	}()
+	// Simulate an outage: the peer and the listener both go away.
+	lconn.Close()
+	listener.Close()
+
+	const n = 5
+	metrics := make([]telegraf.Metric, 0, n)
+	expected := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		m := testutil.TestMetric(int64(i), fmt.Sprintf("testmetric%d", i))
+		metrics = append(metrics, m)
+		msg, err := s.mapMetricToSyslogMessage(m)
+		require.NoError(t, err)
+		expected = append(expected, s.getSyslogMessageBytesWithFraming(msg))
+	}
+	require.NoError(t, s.Write(metrics))
+
+	// Bring the collector back on the same address; the background sender
+	// should reconnect and drain every queued message, in order.
+	listener2, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer listener2.Close()
 
-	metrics := []telegraf.Metric{testutil.TestMetric(1, "testerr")}
-	err = s.Write(metrics)
+	lconn2, err := listener2.Accept()
 	require.NoError(t, err)
 
-	wg.Wait()
-	assert.NoError(t, lerr)
+	r := bufio.NewReader(lconn2)
+	for i, want := range expected {
+		buf := make([]byte, len(want))
+		_, err := io.ReadFull(r, buf)
+		require.NoError(t, err, "metric %d", i)
+		assert.Equal(t, string(want), string(buf), "metric %d arrived out of order", i)
+	}
+}
 
-	syslogMessage, err := s.mapMetricToSyslogMessage(metrics[0])
+func TestDiskSpoolResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	spool, err := newDiskSpool(dir)
 	require.NoError(t, err)
-	messageBytesWithFraming := s.getSyslogMessageBytesWithFraming(syslogMessage)
-	buf := make([]byte, 256)
-	n, err := lconn.Read(buf)
+
+	messages := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+	for _, m := range messages {
+		require.NoError(t, spool.write(m))
+	}
+
+	for i, want := range messages {
+		got, ok := spool.read()
+		require.True(t, ok, "message %d", i)
+		assert.Equal(t, want, got, "message %d", i)
+	}
+	_, ok := spool.read()
+	assert.False(t, ok, "spool should be drained")
+
+	// Simulate a process restart: reopen the spool from the same dir. None
+	// of the already-delivered messages should replay.
+	spool2, err := newDiskSpool(dir)
 	require.NoError(t, err)
-	assert.Equal(t, string(messageBytesWithFraming), string(buf[:n]))
-}
\ No newline at end of file
+	assert.False(t, spool2.hasPending(), "restart should not redeliver drained messages")
+	_, ok = spool2.read()
+	assert.False(t, ok)
+}